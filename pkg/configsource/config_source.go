@@ -0,0 +1,78 @@
+// Package configsource abstracts where the activator and zeroscaler
+// discover apps, their dependencies, and their routes from. The default
+// source is Kubernetes annotations on Services/Deployments/StatefulSets,
+// handled natively by the activator's existing informer-backed index. This
+// package adds KV-store-backed alternatives -- Consul and etcd -- so an
+// operator can drive scale-from-zero routing and dependency chains for
+// services outside the cluster, configured centrally instead of via
+// annotations.
+package configsource
+
+import "context"
+
+// Kind identifies which backend a ConfigSource talks to. It's the value of
+// the `--config-source` flag on the activator and zeroscaler binaries.
+type Kind string
+
+const (
+	KindAnnotations Kind = "annotations"
+	KindConsul      Kind = "consul"
+	KindEtcd        Kind = "etcd"
+)
+
+// kvPrefix is the root under which every app's configuration is stored, for
+// both the Consul and etcd backends:
+//
+//	osiris/apps/<namespace>/<name>/kind
+//	osiris/apps/<namespace>/<name>/dependencies/<i>
+//	osiris/apps/<namespace>/<name>/routes/<i>/rule
+//	osiris/apps/<namespace>/<name>/ports/<port>/target
+const kvPrefix = "osiris/apps/"
+
+// Dependency is a manually-declared, non-HTTP dependency of an app -- the
+// KV-store equivalent of a single entry in the `osiris.dm.gg/dependencies`
+// annotation.
+type Dependency struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// Route is a single KV-store-equivalent of an `osiris.dm.gg/rule(-N)?`
+// annotation value.
+type Route struct {
+	Rule string
+}
+
+// AppConfig is the KV-store-agnostic representation of a single app,
+// mirroring the structure activator.updateIndex derives from Kubernetes
+// annotations today.
+type AppConfig struct {
+	Namespace    string
+	Name         string
+	Kind         string // "deployment" | "statefulset"
+	Dependencies []Dependency
+	Routes       []Route
+	// Ports maps a service port number to the "host:port" it should proxy
+	// to once the app has been activated.
+	Ports map[int]string
+}
+
+// ConfigSource abstracts the backend an activator or zeroscaler uses to
+// discover app configuration. Implementations: annotations (the existing
+// Kubernetes-informer-backed behavior, which does not implement this
+// interface directly -- see New), consul, and etcd.
+type ConfigSource interface {
+	// List returns the full, current set of app configs known to the
+	// backend. The activator calls this once at startup to build its
+	// initial index.
+	List(ctx context.Context) ([]AppConfig, error)
+
+	// Watch blocks, invoking onChange whenever the backing store's config
+	// changes, until ctx is canceled or an unrecoverable error occurs. The
+	// activator rebuilds its index from a fresh List each time onChange
+	// fires -- this keeps the incremental-update contract simple
+	// at the cost of re-listing on every change, which is cheap relative to
+	// the watch's own long-poll/stream latency.
+	Watch(ctx context.Context, onChange func()) error
+}
@@ -0,0 +1,78 @@
+package configsource
+
+import (
+	"context"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// watchWaitTime bounds each Consul blocking query, so a Watch loop can
+// still observe ctx cancellation in a timely fashion instead of blocking
+// indefinitely on a single long-poll.
+const watchWaitTime = 5 * time.Minute
+
+// ConsulConfig holds the connection settings for the Consul ConfigSource,
+// populated from the activator/zeroscaler binaries' CLI flags.
+type ConsulConfig struct {
+	Address string
+	Token   string
+}
+
+type consulConfigSource struct {
+	kv *consulapi.KV
+}
+
+// NewConsulConfigSource returns a ConfigSource backed by a Consul KV store,
+// reading the osiris/apps/ tree described by decodeKVPairs.
+func NewConsulConfigSource(cfg ConsulConfig) (ConfigSource, error) {
+	consulCfg := consulapi.DefaultConfig()
+	if cfg.Address != "" {
+		consulCfg.Address = cfg.Address
+	}
+	if cfg.Token != "" {
+		consulCfg.Token = cfg.Token
+	}
+	client, err := consulapi.NewClient(consulCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &consulConfigSource{kv: client.KV()}, nil
+}
+
+func (c *consulConfigSource) List(ctx context.Context) ([]AppConfig, error) {
+	pairs, _, err := c.kv.List(kvPrefix, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return decodeKVPairs(toKVMap(pairs)), nil
+}
+
+func (c *consulConfigSource) Watch(ctx context.Context, onChange func()) error {
+	var lastIndex uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		queryOpts := (&consulapi.QueryOptions{
+			WaitIndex: lastIndex,
+			WaitTime:  watchWaitTime,
+		}).WithContext(ctx)
+		_, meta, err := c.kv.List(kvPrefix, queryOpts)
+		if err != nil {
+			return err
+		}
+		if meta.LastIndex != lastIndex {
+			lastIndex = meta.LastIndex
+			onChange()
+		}
+	}
+}
+
+func toKVMap(pairs consulapi.KVPairs) map[string]string {
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		m[pair.Key] = string(pair.Value)
+	}
+	return m
+}
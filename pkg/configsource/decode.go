@@ -0,0 +1,89 @@
+package configsource
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// decodeKVPairs turns a flat key/value listing rooted at kvPrefix (as
+// returned by both the Consul and etcd clients) into the AppConfigs it
+// describes. Keys that don't match the expected layout are ignored, with
+// the caller responsible for logging anything noteworthy -- decode errors
+// here are deliberately non-fatal, since a malformed key for one app
+// shouldn't prevent the rest of the KV store from being usable.
+func decodeKVPairs(pairs map[string]string) []AppConfig {
+	appsByKey := map[string]*AppConfig{}
+	var order []string
+	appFor := func(namespace, name string) *AppConfig {
+		key := namespace + "/" + name
+		cfg, ok := appsByKey[key]
+		if !ok {
+			cfg = &AppConfig{
+				Namespace: namespace,
+				Name:      name,
+				Ports:     map[int]string{},
+			}
+			appsByKey[key] = cfg
+			order = append(order, key)
+		}
+		return cfg
+	}
+
+	for key, value := range pairs {
+		rest := strings.TrimPrefix(key, kvPrefix)
+		if rest == key {
+			continue // doesn't have the expected prefix
+		}
+		elems := strings.Split(rest, "/")
+		if len(elems) < 3 {
+			continue
+		}
+		namespace, name := elems[0], elems[1]
+		cfg := appFor(namespace, name)
+		switch elems[2] {
+		case "kind":
+			cfg.Kind = value
+		case "dependencies":
+			if len(elems) != 4 {
+				continue
+			}
+			depElems := strings.SplitN(value, ":", 2)
+			if len(depElems) != 2 {
+				continue
+			}
+			nsAndName := strings.SplitN(depElems[1], "/", 2)
+			if len(nsAndName) != 2 {
+				continue
+			}
+			cfg.Dependencies = append(cfg.Dependencies, Dependency{
+				Kind:      depElems[0],
+				Namespace: nsAndName[0],
+				Name:      nsAndName[1],
+			})
+		case "routes":
+			if len(elems) != 5 || elems[4] != "rule" {
+				continue
+			}
+			cfg.Routes = append(cfg.Routes, Route{Rule: value})
+		case "ports":
+			if len(elems) != 5 || elems[4] != "target" {
+				continue
+			}
+			port, err := strconv.Atoi(elems[3])
+			if err != nil {
+				continue
+			}
+			cfg.Ports[port] = value
+		}
+	}
+
+	// Stable, deterministic output makes this easy to unit test and to
+	// diff in logs.
+	sort.Strings(order)
+	configs := make([]AppConfig, 0, len(order))
+	for _, key := range order {
+		configs = append(configs, *appsByKey[key])
+	}
+	return configs
+}
@@ -0,0 +1,71 @@
+package configsource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeKVPairs(t *testing.T) {
+	pairs := map[string]string{
+		"osiris/apps/ns1/app1/kind":                    "deployment",
+		"osiris/apps/ns1/app1/dependencies/0":          "deployment:ns1/dep1",
+		"osiris/apps/ns1/app1/routes/0/rule":           "Host:foo.example.com",
+		"osiris/apps/ns1/app1/ports/8080/target":       "10.0.0.1:8080",
+		"osiris/apps/ns2/app2/kind":                    "statefulset",
+		"some/unrelated/key":                           "ignored",
+		"osiris/apps/ns1/app1/dependencies/0/extra":    "too many elems, ignored",
+		"osiris/apps/ns1/app1/dependencies/malformed":  "no-colon",
+		"osiris/apps/ns1/app1/routes/0/notrule":        "ignored, wrong leaf",
+		"osiris/apps/ns1/app1/ports/notanumber/target": "ignored, bad port",
+	}
+
+	got := decodeKVPairs(pairs)
+
+	want := []AppConfig{
+		{
+			Namespace: "ns1",
+			Name:      "app1",
+			Kind:      "deployment",
+			Dependencies: []Dependency{
+				{Kind: "deployment", Namespace: "ns1", Name: "dep1"},
+			},
+			Routes: []Route{{Rule: "Host:foo.example.com"}},
+			Ports:  map[int]string{8080: "10.0.0.1:8080"},
+		},
+		{
+			Namespace: "ns2",
+			Name:      "app2",
+			Kind:      "statefulset",
+			Ports:     map[int]string{},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decodeKVPairs() = %#v, want %#v", got, want)
+	}
+}
+
+func TestDecodeKVPairsEmpty(t *testing.T) {
+	got := decodeKVPairs(map[string]string{})
+	if len(got) != 0 {
+		t.Fatalf("expected no configs from an empty KV tree, got %#v", got)
+	}
+}
+
+func TestDecodeKVPairsOrderIsStable(t *testing.T) {
+	pairs := map[string]string{
+		"osiris/apps/ns-z/app/kind": "deployment",
+		"osiris/apps/ns-a/app/kind": "deployment",
+		"osiris/apps/ns-m/app/kind": "deployment",
+	}
+
+	got := decodeKVPairs(pairs)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 configs, got %d", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1].Namespace > got[i].Namespace {
+			t.Fatalf("expected configs sorted by namespace/name key, got %#v", got)
+		}
+	}
+}
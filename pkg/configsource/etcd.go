@@ -0,0 +1,69 @@
+package configsource
+
+import (
+	"context"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const etcdDialTimeout = 5 * time.Second
+
+// EtcdConfig holds the connection settings for the etcd ConfigSource,
+// populated from the activator/zeroscaler binaries' CLI flags.
+type EtcdConfig struct {
+	Endpoints []string
+	Username  string
+	Password  string
+}
+
+type etcdConfigSource struct {
+	client *clientv3.Client
+}
+
+// NewEtcdConfigSource returns a ConfigSource backed by an etcd cluster,
+// reading the osiris/apps/ tree described by decodeKVPairs.
+func NewEtcdConfigSource(cfg EtcdConfig) (ConfigSource, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: etcdDialTimeout,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &etcdConfigSource{client: client}, nil
+}
+
+func (e *etcdConfigSource) List(ctx context.Context) ([]AppConfig, error) {
+	resp, err := e.client.Get(ctx, kvPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		pairs[string(kv.Key)] = string(kv.Value)
+	}
+	return decodeKVPairs(pairs), nil
+}
+
+func (e *etcdConfigSource) Watch(ctx context.Context, onChange func()) error {
+	watchCh := e.client.Watch(ctx, kvPrefix, clientv3.WithPrefix())
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resp, ok := <-watchCh:
+			if !ok {
+				return nil
+			}
+			if err := resp.Err(); err != nil {
+				return err
+			}
+			if len(resp.Events) > 0 {
+				onChange()
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package configsource
+
+import "fmt"
+
+// Config bundles the CLI-flag-derived settings for every backend; only the
+// fields relevant to Kind are read.
+type Config struct {
+	Kind   Kind
+	Consul ConsulConfig
+	Etcd   EtcdConfig
+}
+
+// New constructs the ConfigSource selected by cfg.Kind. KindAnnotations has
+// no ConfigSource of its own -- the activator keeps deriving that index
+// natively from its Kubernetes informers -- so callers should check for it
+// before calling New.
+func New(cfg Config) (ConfigSource, error) {
+	switch cfg.Kind {
+	case KindConsul:
+		return NewConsulConfigSource(cfg.Consul)
+	case KindEtcd:
+		return NewEtcdConfigSource(cfg.Etcd)
+	default:
+		return nil, fmt.Errorf("unknown config source kind %q", cfg.Kind)
+	}
+}
@@ -22,6 +22,7 @@ var (
 // activation. The new index replaces any old/existing index.
 func (a *activator) updateIndex() {
 	appsByHost := map[string]*app{}
+	rules := []*rule{}
 	for _, svc := range a.services {
 		var (
 			name                        string
@@ -173,6 +174,27 @@ func (a *activator) updateIndex() {
 						appsByHost[hostname] = app
 					}
 				}
+				// Honor all annotations of the form
+				// ^osiris\.dm\.gg/rule(?:-\d+)?$ by compiling them into the
+				// rule table walked by getAppForRequest when the host map
+				// misses.
+				for k, v := range svc.Annotations {
+					if !ruleAnnotationRegex.MatchString(k) {
+						continue
+					}
+					compiled, err := parseRule(cleanAnnotationValue(v), app)
+					if err != nil {
+						glog.Errorf(
+							"Error parsing rule annotation %s for service %s in namespace %s: %s",
+							k,
+							svc.Name,
+							svc.Namespace,
+							err,
+						)
+						continue
+					}
+					rules = append(rules, compiled)
+				}
 			}
 			// Now index by hostname/IP:port...
 			// kube-dns names
@@ -204,6 +226,7 @@ func (a *activator) updateIndex() {
 		}
 	}
 	a.appsByHost = appsByHost
+	a.rules = rules
 }
 
 func cleanAnnotationValue(rawValue string) string {
@@ -0,0 +1,163 @@
+package activator
+
+import (
+	"context"
+	"fmt"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/golang/glog"
+
+	"github.com/dailymotion-oss/osiris/pkg/configsource"
+)
+
+// runConfigSourceSync keeps the activator's index in sync with a non-native
+// ConfigSource (Consul or etcd), as an alternative to the default
+// annotations-on-Kubernetes-objects behavior in updateIndex. It performs a
+// bulk List to seed a.appsByHost/a.rules, then blocks on Watch, rebuilding
+// the index from a fresh List every time the backing store reports a
+// change.
+func (a *activator) runConfigSourceSync(ctx context.Context, cs configsource.ConfigSource) {
+	if err := a.syncFromConfigSource(ctx, cs); err != nil {
+		glog.Errorf("Error performing initial sync from config source: %s", err)
+	}
+	err := cs.Watch(ctx, func() {
+		if err := a.syncFromConfigSource(ctx, cs); err != nil {
+			glog.Errorf("Error re-syncing index from config source: %s", err)
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		glog.Errorf("Config source watch ended unexpectedly: %s", err)
+	}
+}
+
+func (a *activator) syncFromConfigSource(
+	ctx context.Context,
+	cs configsource.ConfigSource,
+) error {
+	configs, err := cs.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	// depsByKey holds one app per config entry, carrying only its identity
+	// (namespace, name and kind); dependencies are set on the per-port apps.
+	// It exists solely so dependencies can be resolved by key; routing
+	// always goes through a per-port app below, since a single app value
+	// can only ever point at one TargetURL.
+	depsByKey := map[string]*app{}
+	for _, cfg := range configs {
+		kind := appKindFromString(cfg.Kind)
+		if kind == "" {
+			glog.Errorf(
+				"Error processing config source entry for %s in namespace %s: invalid kind %q",
+				cfg.Name,
+				cfg.Namespace,
+				cfg.Kind,
+			)
+			continue
+		}
+		depsByKey[getKey(cfg.Namespace, kind, cfg.Name)] = &app{
+			Namespace:   cfg.Namespace,
+			Name:        cfg.Name,
+			ServiceName: cfg.Name,
+			Kind:        kind,
+		}
+	}
+
+	appsByHost := map[string]*app{}
+	rules := []*rule{}
+	for _, cfg := range configs {
+		thisApp := depsByKey[getKey(cfg.Namespace, appKindFromString(cfg.Kind), cfg.Name)]
+		if thisApp == nil {
+			continue
+		}
+		var dependencies []*app
+		for _, dep := range cfg.Dependencies {
+			depApp := depsByKey[getKey(dep.Namespace, appKindFromString(dep.Kind), dep.Name)]
+			if depApp == nil {
+				// The dependency lives outside the config source's purview
+				// (e.g. it's still driven by annotations); record just
+				// enough for scaleToZero to find and activate it.
+				depApp = &app{
+					Namespace:   dep.Namespace,
+					Name:        dep.Name,
+					ServiceName: dep.Name,
+					Kind:        appKindFromString(dep.Kind),
+				}
+			}
+			dependencies = append(dependencies, depApp)
+		}
+
+		// Ports are stored in a map, so iteration order is random; allocate
+		// a distinct *app per port (as index.go's updateIndex does for
+		// Kubernetes Service ports) instead of repointing one shared app at
+		// each port's target URL in turn, which would leave every host:port
+		// entry routed to whichever port was processed last.
+		var defaultPort int
+		for port := range cfg.Ports {
+			if defaultPort == 0 || port < defaultPort {
+				defaultPort = port
+			}
+		}
+		var defaultPortApp *app
+		for port, target := range cfg.Ports {
+			targetURL, err := url.Parse(fmt.Sprintf("http://%s", target))
+			if err != nil {
+				glog.Errorf(
+					"Error parsing target %q for %s in namespace %s port %d: %s",
+					target,
+					cfg.Name,
+					cfg.Namespace,
+					port,
+					err,
+				)
+				continue
+			}
+			portApp := &app{
+				Namespace:           cfg.Namespace,
+				Name:                cfg.Name,
+				ServiceName:         cfg.Name,
+				Kind:                thisApp.Kind,
+				Dependencies:        dependencies,
+				TargetURL:           targetURL,
+				proxyRequestHandler: httputil.NewSingleHostReverseProxy(targetURL),
+			}
+			appsByHost[targetURL.Host] = portApp
+			if port == defaultPort {
+				defaultPortApp = portApp
+			}
+		}
+		if defaultPortApp == nil {
+			continue
+		}
+		for _, route := range cfg.Routes {
+			compiled, err := parseRule(route.Rule, defaultPortApp)
+			if err != nil {
+				glog.Errorf(
+					"Error parsing route rule %q for %s in namespace %s: %s",
+					route.Rule,
+					cfg.Name,
+					cfg.Namespace,
+					err,
+				)
+				continue
+			}
+			rules = append(rules, compiled)
+		}
+	}
+	a.appsByHost = appsByHost
+	a.rules = rules
+	return nil
+}
+
+func appKindFromString(s string) appKind {
+	switch s {
+	case "deployment":
+		return appKindDeployment
+	case "statefulset":
+		return appKindStatefulSet
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,257 @@
+package activator
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// nolint: lll
+var ruleAnnotationRegex = regexp.MustCompile(`^osiris\.dm\.gg/rule(?:-\d+)?$`)
+
+// matcherKind identifies which part of an incoming request a single matcher
+// predicate is evaluated against.
+type matcherKind int
+
+const (
+	matcherKindHost matcherKind = iota
+	matcherKindHostRegexp
+	matcherKindPathPrefix
+	matcherKindPath
+	matcherKindHeader
+)
+
+// Relative weight of each matcher kind, used to score a rule's specificity.
+// A rule's priority is the sum of the priorities of its matchers, so, e.g., a
+// rule combining Host and Path matchers outranks a rule with a Path matcher
+// alone.
+const (
+	hostMatcherPriority       = 10
+	pathMatcherPriority       = 6
+	pathPrefixMatcherPriority = 5
+	headerMatcherPriority     = 3
+)
+
+// matcher is a single compiled predicate, e.g. `Host:foo.example.com` or
+// `Header:X-Tenant,acme`. A matcher may carry more than one candidate value
+// when the annotation expressed an any-of list using `,`.
+type matcher struct {
+	kind        matcherKind
+	values      []string
+	hostRegexps []*regexp.Regexp
+	headerName  string
+	priority    int
+}
+
+// rule is a compiled `osiris.dm.gg/rule(-N)?` annotation value: an
+// all-must-match list of matchers, the app it routes to when satisfied, and
+// a specificity score used to pick a winner when more than one rule matches
+// the same request.
+type rule struct {
+	matchers []matcher
+	app      *app
+	priority int
+}
+
+// matches reports whether the given request satisfies every matcher in the
+// rule. A rule with no matchers never matches.
+func (r *rule) matches(host, path string, header http.Header) bool {
+	if len(r.matchers) == 0 {
+		return false
+	}
+	for _, m := range r.matchers {
+		if !m.matches(host, path, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m matcher) matches(host, path string, header http.Header) bool {
+	switch m.kind {
+	case matcherKindHost:
+		return containsFold(m.values, host)
+	case matcherKindHostRegexp:
+		for _, re := range m.hostRegexps {
+			if re.MatchString(host) {
+				return true
+			}
+		}
+		return false
+	case matcherKindPathPrefix:
+		for _, v := range m.values {
+			if strings.HasPrefix(path, v) {
+				return true
+			}
+		}
+		return false
+	case matcherKindPath:
+		for _, v := range m.values {
+			if path == v {
+				return true
+			}
+		}
+		return false
+	case matcherKindHeader:
+		return contains(m.values, header.Get(m.headerName))
+	default:
+		return false
+	}
+}
+
+// parseRule compiles a single `;`-delimited rule annotation value -- e.g.
+// `Host:foo.example.com;PathPrefix:/api` -- into a rule routing to app.
+// Matchers within a single `;`-segment may list alternatives separated by
+// `,`, meaning any one of them satisfies that matcher.
+func parseRule(value string, a *app) (*rule, error) {
+	r := &rule{app: a}
+	for _, segment := range strings.Split(value, ";") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		elems := strings.SplitN(segment, ":", 2)
+		if len(elems) != 2 {
+			return nil, fmt.Errorf("invalid rule matcher %q", segment)
+		}
+		m, err := parseMatcher(elems[0], elems[1])
+		if err != nil {
+			return nil, err
+		}
+		r.matchers = append(r.matchers, m)
+		r.priority += m.priority
+	}
+	if len(r.matchers) == 0 {
+		return nil, fmt.Errorf("rule %q has no matchers", value)
+	}
+	return r, nil
+}
+
+func parseMatcher(kind, rawValues string) (matcher, error) {
+	switch kind {
+	case "Host":
+		return matcher{
+			kind:     matcherKindHost,
+			values:   splitAnyOf(rawValues),
+			priority: hostMatcherPriority,
+		}, nil
+	case "HostRegexp":
+		values := splitAnyOf(rawValues)
+		hostRegexps := make([]*regexp.Regexp, len(values))
+		for i, v := range values {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return matcher{}, fmt.Errorf("invalid HostRegexp matcher %q: %s", v, err)
+			}
+			hostRegexps[i] = re
+		}
+		return matcher{
+			kind:        matcherKindHostRegexp,
+			hostRegexps: hostRegexps,
+			priority:    hostMatcherPriority,
+		}, nil
+	case "PathPrefix":
+		return matcher{
+			kind:     matcherKindPathPrefix,
+			values:   splitAnyOf(rawValues),
+			priority: pathPrefixMatcherPriority,
+		}, nil
+	case "Path":
+		return matcher{
+			kind:     matcherKindPath,
+			values:   splitAnyOf(rawValues),
+			priority: pathMatcherPriority,
+		}, nil
+	case "Header":
+		headerElems := strings.SplitN(rawValues, ",", 2)
+		if len(headerElems) != 2 {
+			return matcher{}, fmt.Errorf("invalid Header matcher %q:%s", kind, rawValues)
+		}
+		values := splitAnyOf(headerElems[1])
+		if len(values) == 0 {
+			return matcher{}, fmt.Errorf("invalid Header matcher %q:%s", kind, rawValues)
+		}
+		return matcher{
+			kind:       matcherKindHeader,
+			headerName: http.CanonicalHeaderKey(strings.TrimSpace(headerElems[0])),
+			values:     values,
+			priority:   headerMatcherPriority,
+		}, nil
+	default:
+		return matcher{}, fmt.Errorf("unknown rule matcher kind %q", kind)
+	}
+}
+
+func splitAnyOf(raw string) []string {
+	rawValues := strings.Split(raw, ",")
+	values := make([]string, 0, len(rawValues))
+	for _, v := range rawValues {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getAppForRequest resolves the app that should handle an incoming request.
+// It first consults the O(1) host map for backwards compatibility with
+// plain host-based routing, then falls back to walking the compiled rule
+// table and returning the app backing the highest-priority matching rule.
+func (a *activator) getAppForRequest(r *http.Request) *app {
+	host := r.Host
+	if i := strings.IndexByte(host, ':'); i >= 0 {
+		if app, ok := a.appsByHost[host]; ok {
+			return app
+		}
+		host = host[:i]
+	}
+	if app, ok := a.appsByHost[host]; ok {
+		return app
+	}
+	var best *rule
+	for _, candidate := range a.rules {
+		if !candidate.matches(host, r.URL.Path, r.Header) {
+			continue
+		}
+		if best == nil || higherPriority(candidate, best) {
+			best = candidate
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.app
+}
+
+// higherPriority reports whether a outranks b. a.rules is built by ranging
+// over a map in updateIndex, so its order is randomized on every rebuild;
+// ties are broken by the target app's namespace/name so that which of two
+// equally-specific rules wins doesn't change from one rebuild to the next.
+func higherPriority(a, b *rule) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.app.Namespace != b.app.Namespace {
+		return a.app.Namespace < b.app.Namespace
+	}
+	return a.app.Name < b.app.Name
+}
@@ -0,0 +1,151 @@
+package activator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	app := &app{Namespace: "ns", Name: "svc"}
+
+	testCases := []struct {
+		name          string
+		value         string
+		errorExpected bool
+	}{
+		{
+			name:  "single host matcher",
+			value: "Host:foo.example.com",
+		},
+		{
+			name:  "host and path prefix combined",
+			value: "Host:foo.example.com;PathPrefix:/api",
+		},
+		{
+			name:  "any-of values on a single matcher",
+			value: "Host:foo.example.com,bar.example.com",
+		},
+		{
+			name:  "header matcher with any-of values",
+			value: "Header:X-Tenant,acme,widgets",
+		},
+		{
+			name:          "unknown matcher kind",
+			value:         "Bogus:foo",
+			errorExpected: true,
+		},
+		{
+			name:          "missing colon",
+			value:         "Host",
+			errorExpected: true,
+		},
+		{
+			name:          "header matcher missing value list",
+			value:         "Header:X-Tenant",
+			errorExpected: true,
+		},
+		{
+			name:          "no matchers",
+			value:         "   ",
+			errorExpected: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r, err := parseRule(testCase.value, app)
+			if testCase.errorExpected {
+				if err == nil {
+					t.Fatalf("expected an error parsing %q, got none", testCase.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %s", testCase.value, err)
+			}
+			if r.app != app {
+				t.Fatalf("expected rule to reference app %v, got %v", app, r.app)
+			}
+			if r.priority == 0 {
+				t.Fatalf("expected a non-zero priority for %q", testCase.value)
+			}
+		})
+	}
+}
+
+func TestParseRuleHeaderAnyOf(t *testing.T) {
+	r, err := parseRule("Header:X-Tenant,acme,widgets", &app{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	header := http.Header{}
+	header.Set("X-Tenant", "widgets")
+	if !r.matches("", "", header) {
+		t.Fatal("expected rule to match one of the any-of header values")
+	}
+	header.Set("X-Tenant", "other")
+	if r.matches("", "", header) {
+		t.Fatal("expected rule not to match a header value outside the any-of list")
+	}
+}
+
+// TestGetAppForRequestDeterministicTiebreak guards against the bug fixed in
+// higherPriority: a.rules is built by ranging over a.services (a map), so its
+// order is randomized on every rebuild. Two equally-specific rules matching
+// the same request must resolve to the same app regardless of which order
+// they appear in a.rules.
+func TestGetAppForRequestDeterministicTiebreak(t *testing.T) {
+	appA := &app{Namespace: "ns-a", Name: "svc"}
+	appB := &app{Namespace: "ns-b", Name: "svc"}
+
+	ruleA, err := parseRule("Host:foo.example.com", appA)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ruleB, err := parseRule("Host:foo.example.com", appB)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://foo.example.com/", nil)
+
+	a1 := &activator{rules: []*rule{ruleA, ruleB}}
+	a2 := &activator{rules: []*rule{ruleB, ruleA}}
+
+	got1 := a1.getAppForRequest(req)
+	got2 := a2.getAppForRequest(req)
+	if got1 != appA || got2 != appA {
+		t.Fatalf("expected the tiebreak to always favor %v, got %v and %v", appA, got1, got2)
+	}
+}
+
+func TestGetAppForRequestHigherPriorityWins(t *testing.T) {
+	hostOnly := &app{Namespace: "ns", Name: "host-only"}
+	hostAndPath := &app{Namespace: "ns", Name: "host-and-path"}
+
+	ruleHostOnly, err := parseRule("Host:foo.example.com", hostOnly)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ruleHostAndPath, err := parseRule("Host:foo.example.com;PathPrefix:/api", hostAndPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://foo.example.com/api/widgets", nil)
+	a := &activator{rules: []*rule{ruleHostOnly, ruleHostAndPath}}
+
+	got := a.getAppForRequest(req)
+	if got != hostAndPath {
+		t.Fatalf("expected the more specific rule's app %v to win, got %v", hostAndPath, got)
+	}
+}
+
+func TestGetAppForRequestNoMatch(t *testing.T) {
+	a := &activator{rules: []*rule{}}
+	req := httptest.NewRequest(http.MethodGet, "http://foo.example.com/", nil)
+	if got := a.getAppForRequest(req); got != nil {
+		t.Fatalf("expected no match, got %v", got)
+	}
+}
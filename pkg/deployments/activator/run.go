@@ -0,0 +1,31 @@
+package activator
+
+import (
+	"context"
+
+	"github.com/dailymotion-oss/osiris/pkg/configsource"
+)
+
+// Run starts the activator's index-building loop, choosing between the two
+// mutually exclusive ways it can learn about apps, based on cfg.Kind: the
+// default, natively Kubernetes-informer-backed annotations behavior
+// (updateIndex, triggered by the activator's existing service/deployment/
+// statefulSet informers), or, for configsource.KindConsul/KindEtcd, a
+// ConfigSource built via configsource.New and kept in sync via
+// runConfigSourceSync.
+//
+// This is the integration point the activator binary's `--config-source`
+// flag selects between; wiring that flag itself, and the binary's main
+// package more broadly, is out of scope here.
+func (a *activator) Run(ctx context.Context, cfg configsource.Config) error {
+	if cfg.Kind == "" || cfg.Kind == configsource.KindAnnotations {
+		a.updateIndex()
+		return nil
+	}
+	cs, err := configsource.New(cfg)
+	if err != nil {
+		return err
+	}
+	a.runConfigSourceSync(ctx, cs)
+	return nil
+}
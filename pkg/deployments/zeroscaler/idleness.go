@@ -0,0 +1,215 @@
+package zeroscaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// idlenessSampleBufferSize bounds how many ticks of history the PromQL
+// idleness predicate is evaluated over. It only needs to cover whatever
+// range vector the configured query itself selects (e.g. `[2m]`); anything
+// older is dropped.
+const idlenessSampleBufferSize = 60
+
+// idlenessSample is one tick's aggregate view across every proxy backing a
+// workload, timestamped so a range-vector query like
+// `rate(osiris_proxy_requests_total[2m])` can be evaluated against it.
+type idlenessSample struct {
+	timestamp    time.Time
+	requestCount uint64
+	openConns    uint64
+	totalConns   uint64
+}
+
+// idlenessEvaluator holds the ring buffer of recent samples for one
+// workload and evaluates its `osiris.dm.gg/idlenessQuery` PromQL expression
+// against them. This replaces the fragile "counter didn't change between
+// two ticks" comparison with a rate-based decision that tolerates scrape
+// jitter and gives operators control over the cool-down window.
+type idlenessEvaluator struct {
+	query   string
+	engine  *promql.Engine
+	samples []idlenessSample
+}
+
+func newIdlenessEvaluator(query string) *idlenessEvaluator {
+	return &idlenessEvaluator{
+		query: query,
+		engine: promql.NewEngine(promql.EngineOpts{
+			MaxSamples:               50000,
+			Timeout:                  3 * time.Second,
+			NoStepSubqueryIntervalFn: func(int64) int64 { return 0 },
+		}),
+	}
+}
+
+// record appends the latest tick's aggregate counters to the buffer,
+// evicting samples older than the buffer size.
+func (e *idlenessEvaluator) record(sample idlenessSample) {
+	e.samples = append(e.samples, sample)
+	if len(e.samples) > idlenessSampleBufferSize {
+		e.samples = e.samples[len(e.samples)-idlenessSampleBufferSize:]
+	}
+}
+
+// isIdle evaluates the configured query as an instant query at "now" (the
+// timestamp of the most recent recorded sample) and reports whether it
+// produced a non-empty result -- i.e. whether the idleness condition, such
+// as `sum(rate(osiris_proxy_requests_total[2m])) == 0`, currently holds.
+func (e *idlenessEvaluator) isIdle(ctx context.Context) (bool, error) {
+	if len(e.samples) == 0 {
+		return false, nil
+	}
+	now := e.samples[len(e.samples)-1].timestamp
+	q, err := e.engine.NewInstantQuery(
+		&sampleBufferQueryable{samples: e.samples},
+		nil,
+		e.query,
+		now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error parsing idleness query %q: %s", e.query, err)
+	}
+	defer q.Close()
+
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		return false, fmt.Errorf("error evaluating idleness query %q: %s", e.query, res.Err)
+	}
+	vec, err := res.Vector()
+	if err != nil {
+		return false, fmt.Errorf("idleness query %q did not return an instant vector: %s", e.query, err)
+	}
+	return len(vec) > 0, nil
+}
+
+// sampleBufferQueryable adapts an idlenessEvaluator's in-memory sample
+// buffer to storage.Queryable, exposing exactly the three series the
+// zeroscaler's scrapers populate: osiris_proxy_requests_total,
+// osiris_proxy_open_connections, and osiris_proxy_connections_total.
+type sampleBufferQueryable struct {
+	samples []idlenessSample
+}
+
+func (q *sampleBufferQueryable) Querier(_ context.Context, _, _ int64) (storage.Querier, error) {
+	return &sampleBufferQuerier{samples: q.samples}, nil
+}
+
+type sampleBufferQuerier struct {
+	samples []idlenessSample
+}
+
+func (q *sampleBufferQuerier) Select(
+	_ bool,
+	_ *storage.SelectHints,
+	matchers ...*labels.Matcher,
+) storage.SeriesSet {
+	var metricName string
+	for _, m := range matchers {
+		if m.Name == labels.MetricName {
+			metricName = m.Value
+		}
+	}
+	var series storage.Series
+	switch metricName {
+	case prometheusRequestCountMetric:
+		series = newSampleSeries(metricName, q.samples, func(s idlenessSample) float64 {
+			return float64(s.requestCount)
+		})
+	case prometheusOpenConnectionsMetric:
+		series = newSampleSeries(metricName, q.samples, func(s idlenessSample) float64 {
+			return float64(s.openConns)
+		})
+	case prometheusTotalConnectionsMetric:
+		series = newSampleSeries(metricName, q.samples, func(s idlenessSample) float64 {
+			return float64(s.totalConns)
+		})
+	default:
+		return storage.EmptySeriesSet()
+	}
+	return &singleSeriesSet{series: series}
+}
+
+func (q *sampleBufferQuerier) LabelValues(string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+func (q *sampleBufferQuerier) LabelNames(...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+func (q *sampleBufferQuerier) Close() error { return nil }
+
+func newSampleSeries(
+	name string,
+	samples []idlenessSample,
+	value func(idlenessSample) float64,
+) storage.Series {
+	lbls := labels.FromStrings(labels.MetricName, name)
+	points := make([]promql.Point, len(samples))
+	for i, s := range samples {
+		points[i] = promql.Point{T: s.timestamp.UnixNano() / int64(time.Millisecond), V: value(s)}
+	}
+	return &pointSeries{lbls: lbls, points: points}
+}
+
+// pointSeries is the simplest possible storage.Series: a fixed, pre-sorted
+// slice of points for a single label set.
+type pointSeries struct {
+	lbls   labels.Labels
+	points []promql.Point
+}
+
+func (s *pointSeries) Labels() labels.Labels { return s.lbls }
+
+func (s *pointSeries) Iterator() chunkenc.Iterator {
+	return &pointSeriesIterator{points: s.points, idx: -1}
+}
+
+type pointSeriesIterator struct {
+	points []promql.Point
+	idx    int
+}
+
+func (it *pointSeriesIterator) Seek(t int64) bool {
+	for it.idx < len(it.points)-1 {
+		it.idx++
+		if it.points[it.idx].T >= t {
+			return true
+		}
+	}
+	return false
+}
+func (it *pointSeriesIterator) At() (int64, float64) {
+	p := it.points[it.idx]
+	return p.T, p.V
+}
+func (it *pointSeriesIterator) Next() bool {
+	if it.idx+1 >= len(it.points) {
+		return false
+	}
+	it.idx++
+	return true
+}
+func (it *pointSeriesIterator) Err() error { return nil }
+
+// singleSeriesSet wraps a single storage.Series as a storage.SeriesSet.
+type singleSeriesSet struct {
+	series storage.Series
+	used   bool
+}
+
+func (s *singleSeriesSet) Next() bool {
+	if s.used || s.series == nil {
+		return false
+	}
+	s.used = true
+	return true
+}
+func (s *singleSeriesSet) At() storage.Series         { return s.series }
+func (s *singleSeriesSet) Err() error                 { return nil }
+func (s *singleSeriesSet) Warnings() storage.Warnings { return nil }
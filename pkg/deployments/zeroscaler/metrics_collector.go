@@ -27,11 +27,21 @@ type metricsCollectorConfig struct {
 	metricsCheckInterval    time.Duration
 	scraperConfig           metricsScraperConfig
 	informerRefreshInterval time.Duration
+	// idlenessQuery is a PromQL expression evaluated against the last
+	// idlenessSampleBufferSize ticks of scraped metrics. When it produces a
+	// non-empty instant vector, the workload is considered idle. This
+	// replaces the default "counter didn't change between two ticks" check
+	// with a rate-based decision that tolerates scrape jitter and lets
+	// operators control the cool-down window per workload. If left unset,
+	// newMetricsCollector resolves it from the app's
+	// `osiris.dm.gg/idlenessQuery` annotation.
+	idlenessQuery string
 }
 
 type metricsCollector struct {
 	config       metricsCollectorConfig
 	scraper      metricsScraper
+	idleness     *idlenessEvaluator
 	kubeClient   kubernetes.Interface
 	podsInformer cache.SharedIndexInformer
 	appPods      map[string]*corev1.Pod
@@ -47,6 +57,14 @@ func newMetricsCollector(
 	if err != nil {
 		return nil, err
 	}
+	if config.idlenessQuery == "" {
+		config.idlenessQuery = idlenessQueryAnnotation(
+			kubeClient,
+			config.appKind,
+			config.appNamespace,
+			config.appName,
+		)
+	}
 	m := &metricsCollector{
 		config:     config,
 		scraper:    s,
@@ -60,6 +78,9 @@ func newMetricsCollector(
 		),
 		appPods: map[string]*corev1.Pod{},
 	}
+	if config.idlenessQuery != "" {
+		m.idleness = newIdlenessEvaluator(config.idlenessQuery)
+	}
 	m.podsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: m.syncAppPod,
 		UpdateFunc: func(_, newObj interface{}) {
@@ -114,8 +135,10 @@ func (m *metricsCollector) syncDeletedAppPod(obj interface{}) {
 func (m *metricsCollector) collectMetrics(ctx context.Context) {
 	var (
 		requestCountsByProxy     = map[string]uint64{}
-		requestCountsByProxyLock sync.Mutex
+		connectionCountsByProxy  = map[string]proxyConnectionCounts{}
+		countsByProxyLock        sync.Mutex
 		lastTotalRequestCount    uint64
+		lastTotalConnectionCount uint64
 		ticker                   = time.NewTicker(m.config.metricsCheckInterval)
 	)
 	defer ticker.Stop()
@@ -124,8 +147,9 @@ func (m *metricsCollector) collectMetrics(ctx context.Context) {
 		case <-ticker.C:
 			m.appPodsLock.Lock()
 			var (
-				mustNotDecide bool
-				scrapeWG      sync.WaitGroup
+				mustNotDecide       bool
+				inFlightRequestSeen bool
+				scrapeWG            sync.WaitGroup
 			)
 			// An aggressively small timeout. We make the decision fast or not at
 			// all.
@@ -139,18 +163,29 @@ func (m *metricsCollector) collectMetrics(ctx context.Context) {
 					if prc == nil {
 						mustNotDecide = true
 					} else {
-						requestCountsByProxyLock.Lock()
+						countsByProxyLock.Lock()
 						requestCountsByProxy[prc.ProxyID] = prc.RequestCount
-						requestCountsByProxyLock.Unlock()
+						connectionCountsByProxy[prc.ProxyID] = proxyConnectionCounts{
+							open:  prc.OpenConnections,
+							total: prc.TotalConnections,
+						}
+						if prc.InFlightRequests > 0 {
+							inFlightRequestSeen = true
+						}
+						countsByProxyLock.Unlock()
 					}
 				}(pod)
 			}
 			m.appPodsLock.Unlock()
 			scrapeWG.Wait()
-			var totalRequestCount uint64
+			var totalRequestCount, openConnectionCount, totalConnectionCount uint64
 			for _, requestCount := range requestCountsByProxy {
 				totalRequestCount += requestCount
 			}
+			for _, connectionCounts := range connectionCountsByProxy {
+				openConnectionCount += connectionCounts.open
+				totalConnectionCount += connectionCounts.total
+			}
 			select {
 			case <-timer.C:
 				mustNotDecide = true
@@ -159,16 +194,62 @@ func (m *metricsCollector) collectMetrics(ctx context.Context) {
 			default:
 			}
 			timer.Stop()
-			if !mustNotDecide && totalRequestCount == lastTotalRequestCount {
+			// Unless an idlenessQuery is configured (in which case its result
+			// alone decides idleness, below), a workload is idle only once
+			// both signals agree: no open
+			// connections right now, and the monotonic connection counter
+			// hasn't moved since the last tick. The request-count-only check
+			// by itself is enough for pure HTTP workloads, but for
+			// long-lived TCP/gRPC streams it would otherwise scale to zero
+			// mid-stream, since a quiet-but-open stream never increments the
+			// request count.
+			idle := totalRequestCount == lastTotalRequestCount &&
+				openConnectionCount == 0 &&
+				totalConnectionCount == lastTotalConnectionCount
+			// Regardless of what the idleness check decides, never scale to
+			// zero while any proxy is in the middle of handling a request --
+			// otherwise a scale-to-zero decided mid-request would strand
+			// that client when the pod terminates.
+			if inFlightRequestSeen {
+				mustNotDecide = true
+			}
+			if m.idleness != nil {
+				m.idleness.record(idlenessSample{
+					timestamp:    time.Now(),
+					requestCount: totalRequestCount,
+					openConns:    openConnectionCount,
+					totalConns:   totalConnectionCount,
+				})
+				var err error
+				if idle, err = m.idleness.isIdle(ctx); err != nil {
+					glog.Errorf(
+						"Error evaluating idleness query for %s %s in namespace %s: %s",
+						m.config.appKind,
+						m.config.appName,
+						m.config.appNamespace,
+						err,
+					)
+					mustNotDecide = true
+				}
+			}
+			if !mustNotDecide && idle {
 				m.scaleToZero(context.TODO())
 			}
 			lastTotalRequestCount = totalRequestCount
+			lastTotalConnectionCount = totalConnectionCount
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// proxyConnectionCounts holds a single scrape's view of one proxy's open
+// (gauge) and total (monotonic) connection counts.
+type proxyConnectionCounts struct {
+	open  uint64
+	total uint64
+}
+
 func (m *metricsCollector) scaleToZero(ctx context.Context) {
 	// scale the main app to zero first
 	scaleToZero(ctx, m.kubeClient, m.config.appKind, m.config.appNamespace, m.config.appName)
@@ -247,6 +328,37 @@ func scaleToZero(ctx context.Context, kubeClient kubernetes.Interface, kind, nam
 	glog.Infof("Scaled %s %s in namespace %s to zero", kind, name, namespace)
 }
 
+// idlenessQueryAnnotation reads the `osiris.dm.gg/idlenessQuery` annotation
+// off the app's Deployment or StatefulSet, if any, mirroring how
+// scaleToZero reads the `osiris.dm.gg/dependencies` annotation off the same
+// object.
+func idlenessQueryAnnotation(
+	kubeClient kubernetes.Interface,
+	kind, namespace, name string,
+) string {
+	switch strings.ToLower(kind) {
+	case "deployment":
+		deployment, err := kubeClient.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error retrieving deployment %s in namespace %s: %s", name, namespace, err)
+			return ""
+		}
+		if deployment.Annotations != nil {
+			return cleanAnnotationValue(deployment.Annotations["osiris.dm.gg/idlenessQuery"])
+		}
+	case "statefulset":
+		statefulset, err := kubeClient.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error retrieving statefulset %s in namespace %s: %s", name, namespace, err)
+			return ""
+		}
+		if statefulset.Annotations != nil {
+			return cleanAnnotationValue(statefulset.Annotations["osiris.dm.gg/idlenessQuery"])
+		}
+	}
+	return ""
+}
+
 func cleanAnnotationValue(rawValue string) string {
 	value := strings.TrimSpace(rawValue)
 	value = strings.TrimLeft(value, "'")
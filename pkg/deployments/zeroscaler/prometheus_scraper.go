@@ -0,0 +1,108 @@
+package zeroscaler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// prometheusRequestCountMetric, prometheusOpenConnectionsMetric, and
+// prometheusTotalConnectionsMetric are the metric names the proxy sidecar
+// exposes on its `/metrics` endpoint, alongside its existing bespoke
+// {ProxyID, RequestCount} payload, so the same sidecar can be scraped by
+// both Osiris and cluster-wide Prometheus.
+const (
+	prometheusRequestCountMetric     = "osiris_proxy_requests_total"
+	prometheusOpenConnectionsMetric  = "osiris_proxy_open_connections"
+	prometheusTotalConnectionsMetric = "osiris_proxy_connections_total"
+	prometheusInFlightRequestsMetric = "osiris_proxy_in_flight_requests"
+	prometheusProxyIDLabel           = "proxy_id"
+	prometheusScrapeTimeout          = 3 * time.Second
+)
+
+// prometheusMetricsScraper is the metricsScraper implementation that reads
+// the standard Prometheus exposition format from a proxy pod's /metrics
+// endpoint, instead of the bespoke JSON payload the default scraper
+// expects.
+type prometheusMetricsScraper struct {
+	httpClient *http.Client
+	port       int
+	path       string
+}
+
+func newPrometheusMetricsScraper(config metricsScraperConfig) *prometheusMetricsScraper {
+	path := config.path
+	if path == "" {
+		path = "/metrics"
+	}
+	return &prometheusMetricsScraper{
+		httpClient: &http.Client{Timeout: prometheusScrapeTimeout},
+		port:       config.port,
+		path:       path,
+	}
+}
+
+func (p *prometheusMetricsScraper) Scrape(pod *corev1.Pod) *podRequestCount {
+	url := fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, p.port, p.path)
+	resp, err := p.httpClient.Get(url)
+	if err != nil {
+		glog.Errorf("Error scraping metrics from pod %s: %s", pod.Name, err)
+		return nil
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		glog.Errorf("Error parsing metrics scraped from pod %s: %s", pod.Name, err)
+		return nil
+	}
+
+	prc := &podRequestCount{}
+	var sawRequestCount bool
+	if family, ok := families[prometheusRequestCountMetric]; ok {
+		for _, m := range family.GetMetric() {
+			prc.ProxyID = labelValue(m, prometheusProxyIDLabel)
+			prc.RequestCount += uint64(m.GetCounter().GetValue())
+			sawRequestCount = true
+		}
+	}
+	if !sawRequestCount {
+		glog.Errorf(
+			"Metrics scraped from pod %s had no %s sample",
+			pod.Name,
+			prometheusRequestCountMetric,
+		)
+		return nil
+	}
+	if family, ok := families[prometheusOpenConnectionsMetric]; ok {
+		for _, m := range family.GetMetric() {
+			prc.OpenConnections += uint64(m.GetGauge().GetValue())
+		}
+	}
+	if family, ok := families[prometheusTotalConnectionsMetric]; ok {
+		for _, m := range family.GetMetric() {
+			prc.TotalConnections += uint64(m.GetCounter().GetValue())
+		}
+	}
+	if family, ok := families[prometheusInFlightRequestsMetric]; ok {
+		for _, m := range family.GetMetric() {
+			prc.InFlightRequests += uint64(m.GetGauge().GetValue())
+		}
+	}
+	return prc
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, pair := range m.GetLabel() {
+		if pair.GetName() == name {
+			return pair.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package injector
+
+import (
+	"fmt"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// drainTimeoutAnnotationRegex matches the `osiris.dm.gg/drainTimeout`
+// annotation, which overrides the proxy's default drain timeout (how long
+// it waits for in-flight requests to finish before shutting down).
+// nolint: lll
+var drainTimeoutAnnotationRegex = regexp.MustCompile(`^osiris\.dm\.gg/drainTimeout$`)
+
+// drainTimeoutFlag builds the proxy sidecar's `--drain-timeout` flag from
+// the pod's `osiris.dm.gg/drainTimeout` annotation, if present.
+func drainTimeoutFlag(annotations map[string]string) string {
+	for k, v := range annotations {
+		if drainTimeoutAnnotationRegex.MatchString(k) {
+			return fmt.Sprintf("--drain-timeout=%s", v)
+		}
+	}
+	return ""
+}
+
+// preStopHook builds the proxy sidecar container's preStop lifecycle hook.
+// It invokes the proxy's own /drain endpoint -- served on the management
+// port, not the app-facing proxy port, since the two are no longer shared --
+// so the container's termination grace period -- which Kubernetes otherwise
+// doesn't coordinate with the proxy's drain at all -- waits for in-flight
+// requests to drain the same way a SIGTERM-triggered shutdown would.
+//
+// Kubernetes runs preStop before sending SIGTERM, so this buys the drain an
+// extra window bounded by the container's own terminationGracePeriodSeconds
+// instead of relying solely on the time between SIGTERM and SIGKILL.
+func preStopHook(managementPort int) *corev1.Lifecycle {
+	return &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: "/drain",
+				Port: intstr.FromInt(managementPort),
+			},
+		},
+	}
+}
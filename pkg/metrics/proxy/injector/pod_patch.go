@@ -0,0 +1,97 @@
+package injector
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionsv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/dailymotion-oss/osiris/pkg/kubernetes"
+)
+
+// proxyContainerName is the name of the proxy sidecar container this
+// injector patches onto osiris-enabled pods.
+const proxyContainerName = "osiris-proxy"
+
+// getPodPatchOperations builds the JSON patch that augments the proxy
+// sidecar container already present on the pod with the
+// `--probe-endpoint`, `--ignored-user-agent`, `--drain-timeout`, and
+// `--protocol` flags
+// derived from the pod's app containers' probes and its annotations, plus
+// the preStop hook that lines the container's termination grace period up
+// with the proxy's own drain.
+func (i *injector) getPodPatchOperations(
+	ar *admissionsv1.AdmissionReview,
+) ([]kubernetes.PatchOperation, error) {
+	var pod corev1.Pod
+	if err := json.Unmarshal(ar.Request.Object.Raw, &pod); err != nil {
+		return nil, fmt.Errorf("error unmarshaling pod: %s", err)
+	}
+
+	proxyIndex := -1
+	for idx, c := range pod.Spec.Containers {
+		if c.Name == proxyContainerName {
+			proxyIndex = idx
+			break
+		}
+	}
+	if proxyIndex < 0 {
+		// Not an osiris-enabled pod (or the proxy sidecar hasn't been added
+		// yet by an earlier admission webhook); nothing to patch.
+		return nil, nil
+	}
+	proxyContainer := pod.Spec.Containers[proxyIndex]
+
+	var flags []string
+	for _, c := range pod.Spec.Containers {
+		if c.Name == proxyContainerName {
+			continue
+		}
+		flags = append(flags, probeEndpointFlags(c)...)
+	}
+	for _, substr := range ignoredUserAgentSubstrings(pod.Annotations) {
+		flags = append(flags, fmt.Sprintf("--ignored-user-agent=%s", substr))
+	}
+	if flag := drainTimeoutFlag(pod.Annotations); flag != "" {
+		flags = append(flags, flag)
+	}
+	if flag := proxyProtocolFlag(pod.Annotations); flag != "" {
+		flags = append(flags, flag)
+	}
+
+	var patchOps []kubernetes.PatchOperation
+	if len(flags) > 0 {
+		args := append(append([]string{}, proxyContainer.Args...), flags...)
+		patchOps = append(patchOps, kubernetes.PatchOperation{
+			Op:    "replace",
+			Path:  fmt.Sprintf("/spec/containers/%d/args", proxyIndex),
+			Value: args,
+		})
+	}
+
+	if managementPort := managementContainerPort(proxyContainer); managementPort > 0 {
+		patchOps = append(patchOps, kubernetes.PatchOperation{
+			Op:    "replace",
+			Path:  fmt.Sprintf("/spec/containers/%d/lifecycle", proxyIndex),
+			Value: preStopHook(managementPort),
+		})
+	}
+
+	return patchOps, nil
+}
+
+// managementContainerPort resolves the proxy sidecar's management port
+// (serving /metrics and /drain) from its container spec: a port explicitly
+// named "management", or, failing that, its only port, if it has just one.
+func managementContainerPort(c corev1.Container) int {
+	for _, p := range c.Ports {
+		if p.Name == "management" {
+			return int(p.ContainerPort)
+		}
+	}
+	if len(c.Ports) == 1 {
+		return int(c.Ports[0].ContainerPort)
+	}
+	return 0
+}
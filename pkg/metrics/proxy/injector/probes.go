@@ -0,0 +1,124 @@
+package injector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ignoredUserAgentsAnnotationRegex matches the
+// `osiris.dm.gg/ignoredUserAgents` annotation, whose value is a
+// comma-separated list of User-Agent substrings (e.g. Envoy, Consul, or a
+// custom load balancer's health-check client) that the proxy should not
+// count as traffic.
+// nolint: lll
+var ignoredUserAgentsAnnotationRegex = regexp.MustCompile(`^osiris\.dm\.gg/ignoredUserAgents$`)
+
+// resolvedProbeEndpoint is the {host, port, path, httpHeaders} tuple read
+// off a single HTTPGet probe, in the `--probe-endpoint host:port/path`
+// (optionally `#Header=value;...`) format the proxy sidecar's flag expects.
+type resolvedProbeEndpoint struct {
+	host    string
+	port    string
+	path    string
+	headers map[string]string
+}
+
+// probeEndpointFlags resolves every HTTPGet liveness/readiness/startup
+// probe on container into `--probe-endpoint` flag values, so the proxy can
+// recognize kubelet's own probes by where they land instead of by sniffing
+// their User-Agent.
+func probeEndpointFlags(container corev1.Container) []string {
+	var endpoints []resolvedProbeEndpoint
+	for _, probe := range []*corev1.Probe{
+		container.LivenessProbe,
+		container.ReadinessProbe,
+		container.StartupProbe,
+	} {
+		if probe == nil || probe.HTTPGet == nil {
+			continue
+		}
+		endpoints = append(endpoints, resolveProbeEndpoint(container, probe.HTTPGet))
+	}
+
+	flags := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		flags[i] = fmt.Sprintf("--probe-endpoint=%s", ep.flagValue())
+	}
+	return flags
+}
+
+func resolveProbeEndpoint(
+	container corev1.Container,
+	httpGet *corev1.HTTPGetAction,
+) resolvedProbeEndpoint {
+	// kubelet defaults to probing the pod IP directly, never a hostname, so
+	// httpGet.Host is empty for virtually every real probe. Leave host
+	// empty in that case -- matching the existing pe.Port/pe.Headers
+	// optionality pattern -- so isIgnoredProbe treats it as "no host
+	// constraint" instead of comparing against a literal "localhost" that
+	// the incoming Host header (the pod IP) would never match.
+	host := httpGet.Host
+	port := httpGet.Port.String()
+	if httpGet.Port.Type == intstr.String {
+		// Named ports are resolved against the container spec so the proxy
+		// can match on the concrete port number it's listening on behalf
+		// of.
+		for _, p := range container.Ports {
+			if p.Name == httpGet.Port.StrVal {
+				port = fmt.Sprintf("%d", p.ContainerPort)
+				break
+			}
+		}
+	}
+	path := httpGet.Path
+	if path == "" {
+		// Matches kubelet's own default for an HTTPGet probe with no path
+		// set.
+		path = "/"
+	}
+	ep := resolvedProbeEndpoint{
+		host: host,
+		port: port,
+		path: path,
+	}
+	if len(httpGet.HTTPHeaders) > 0 {
+		ep.headers = map[string]string{}
+		for _, h := range httpGet.HTTPHeaders {
+			ep.headers[h.Name] = h.Value
+		}
+	}
+	return ep
+}
+
+func (ep resolvedProbeEndpoint) flagValue() string {
+	value := fmt.Sprintf("%s:%s%s", ep.host, ep.port, ep.path)
+	if len(ep.headers) == 0 {
+		return value
+	}
+	pairs := make([]string, 0, len(ep.headers))
+	for name, val := range ep.headers {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, val))
+	}
+	return fmt.Sprintf("%s#%s", value, strings.Join(pairs, ";"))
+}
+
+// ignoredUserAgentSubstrings extracts the comma-separated substring list
+// from the pod's `osiris.dm.gg/ignoredUserAgents` annotation, if present.
+func ignoredUserAgentSubstrings(annotations map[string]string) []string {
+	var substrings []string
+	for k, v := range annotations {
+		if !ignoredUserAgentsAnnotationRegex.MatchString(k) {
+			continue
+		}
+		for _, substr := range strings.Split(v, ",") {
+			if substr = strings.TrimSpace(substr); substr != "" {
+				substrings = append(substrings, substr)
+			}
+		}
+	}
+	return substrings
+}
@@ -0,0 +1,26 @@
+package injector
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// proxyProtocolAnnotationRegex matches the `osiris.dm.gg/proxy.protocol`
+// annotation, which selects which proxy implementation the sidecar runs:
+// "http" (the default, HTTP-aware singlePortProxy) or "tcp"/"grpc" (the
+// layer-4 singlePortTCPProxy).
+// nolint: lll
+var proxyProtocolAnnotationRegex = regexp.MustCompile(`^osiris\.dm\.gg/proxy\.protocol$`)
+
+// proxyProtocolFlag builds the proxy sidecar's `--protocol` flag from the
+// pod's `osiris.dm.gg/proxy.protocol` annotation, if present. An unset
+// annotation emits no flag, leaving the proxy binary's own "http" default
+// in effect.
+func proxyProtocolFlag(annotations map[string]string) string {
+	for k, v := range annotations {
+		if proxyProtocolAnnotationRegex.MatchString(k) {
+			return fmt.Sprintf("--protocol=%s", v)
+		}
+	}
+	return ""
+}
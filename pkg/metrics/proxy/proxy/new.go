@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Runner is started by the proxy binary's main loop once the right
+// implementation has been selected; singlePortProxy and singlePortTCPProxy
+// both satisfy it.
+type Runner interface {
+	run(ctx context.Context)
+}
+
+// Config bundles every setting either proxy implementation needs. Only the
+// fields relevant to Protocol are read: DrainTimeout/IgnoredPaths/
+// ProbeEndpoints/IgnoredUserAgentSubstrings/InFlightRequests for "http" (the
+// default), OpenConnections/TotalConnections for "tcp"/"grpc".
+type Config struct {
+	ProxyPort      int
+	ManagementPort int
+	AppPort        int
+	ProxyID        string
+	Protocol       string
+
+	RequestCount *uint64
+
+	// http-only
+	InFlightRequests           *int64
+	DrainTimeout               time.Duration
+	IgnoredPaths               map[string]struct{}
+	ProbeEndpoints             []probeEndpoint
+	IgnoredUserAgentSubstrings []string
+
+	// tcp/grpc-only
+	OpenConnections  *int64
+	TotalConnections *uint64
+}
+
+// New constructs whichever proxy implementation cfg.Protocol selects -- the
+// integration point the proxy binary's `--protocol` flag (itself populated
+// from the injector's `osiris.dm.gg/proxy.protocol`-derived flag) is meant
+// to call.
+func New(cfg Config) (Runner, error) {
+	switch proxyProtocol(cfg.Protocol) {
+	case "", proxyProtocolHTTP:
+		return newSinglePortProxy(
+			cfg.ProxyPort,
+			cfg.ManagementPort,
+			cfg.AppPort,
+			cfg.ProxyID,
+			cfg.RequestCount,
+			cfg.InFlightRequests,
+			cfg.DrainTimeout,
+			cfg.IgnoredPaths,
+			cfg.ProbeEndpoints,
+			cfg.IgnoredUserAgentSubstrings,
+		)
+	case proxyProtocolTCP, proxyProtocolGRPC:
+		return newSinglePortTCPProxy(
+			cfg.ProxyPort,
+			cfg.ManagementPort,
+			cfg.AppPort,
+			cfg.ProxyID,
+			proxyProtocol(cfg.Protocol),
+			cfg.OpenConnections,
+			cfg.TotalConnections,
+			cfg.RequestCount,
+		)
+	default:
+		return nil, fmt.Errorf("unknown proxy protocol %q", cfg.Protocol)
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// probeEndpoint is a resolved kubelet HTTPGet probe target -- the
+// {host, port, path, httpHeaders} tuple the injector read off a container's
+// livenessProbe/readinessProbe/startupProbe -- that isIgnoredProbe matches
+// incoming requests against.
+type probeEndpoint struct {
+	Host    string
+	Port    string
+	Path    string
+	Headers map[string]string
+}
+
+// parseProbeEndpointFlag parses a single `--probe-endpoint` flag value, as
+// emitted by the injector: `host:port/path`, optionally followed by
+// `#Header=value;Header2=value2` for probes that set custom headers.
+func parseProbeEndpointFlag(raw string) (probeEndpoint, error) {
+	hostPortPath := raw
+	var headerPart string
+	if i := strings.IndexByte(raw, '#'); i >= 0 {
+		hostPortPath, headerPart = raw[:i], raw[i+1:]
+	}
+
+	slashIdx := strings.IndexByte(hostPortPath, '/')
+	if slashIdx < 0 {
+		return probeEndpoint{}, fmt.Errorf("invalid probe endpoint %q: missing path", raw)
+	}
+	hostPort, path := hostPortPath[:slashIdx], hostPortPath[slashIdx:]
+
+	colonIdx := strings.LastIndexByte(hostPort, ':')
+	if colonIdx < 0 {
+		return probeEndpoint{}, fmt.Errorf("invalid probe endpoint %q: missing port", raw)
+	}
+	pe := probeEndpoint{
+		Host: hostPort[:colonIdx],
+		Port: hostPort[colonIdx+1:],
+		Path: path,
+	}
+
+	if headerPart != "" {
+		pe.Headers = map[string]string{}
+		for _, header := range strings.Split(headerPart, ";") {
+			elems := strings.SplitN(header, "=", 2)
+			if len(elems) != 2 {
+				return probeEndpoint{}, fmt.Errorf("invalid probe endpoint header %q", header)
+			}
+			pe.Headers[elems[0]] = elems[1]
+		}
+	}
+
+	return pe, nil
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -16,36 +17,84 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultIgnoredUserAgentSubstrings preserves the proxy's long-standing
+// behavior of not counting kubelet's own probes, even when no probe
+// endpoints could be resolved (e.g. an exec or tcpSocket probe) and no
+// `osiris.dm.gg/ignoredUserAgents` annotation was set.
+var defaultIgnoredUserAgentSubstrings = []string{"kube-probe"}
+
+// defaultDrainTimeout bounds how long the proxy waits, during shutdown, for
+// its in-flight request gauge to reach zero before giving up and closing
+// anyway. It's overridable via `--drain-timeout` so it can be aligned with
+// the pod's terminationGracePeriodSeconds.
+const defaultDrainTimeout = 5 * time.Second
+
 type singlePortProxy struct {
-	appPort             int
-	requestCount        *uint64
-	srv                 *http.Server
-	proxyRequestHandler *httputil.ReverseProxy
-	ignoredPaths        map[string]struct{}
+	appPort                    int
+	proxyID                    string
+	requestCount               *uint64
+	inFlightRequests           *int64
+	drainTimeout               time.Duration
+	srv                        *http.Server
+	managementSrv              *http.Server
+	proxyRequestHandler        *httputil.ReverseProxy
+	ignoredPaths               map[string]struct{}
+	probeEndpoints             []probeEndpoint
+	ignoredUserAgentSubstrings []string
 }
 
 func newSinglePortProxy(
 	proxyPort int,
+	managementPort int,
 	appPort int,
+	proxyID string,
 	requestCount *uint64,
+	inFlightRequests *int64,
+	drainTimeout time.Duration,
 	ignoredPaths map[string]struct{},
+	probeEndpoints []probeEndpoint,
+	ignoredUserAgentSubstrings []string,
 ) (*singlePortProxy, error) {
 	targetURL, err := url.Parse(fmt.Sprintf("http://localhost:%d", appPort))
 	if err != nil {
 		return nil, err
 	}
+	if drainTimeout == 0 {
+		drainTimeout = defaultDrainTimeout
+	}
 	mux := http.NewServeMux()
 	s := &singlePortProxy{
-		appPort:      appPort,
-		requestCount: requestCount,
+		appPort:          appPort,
+		proxyID:          proxyID,
+		requestCount:     requestCount,
+		inFlightRequests: inFlightRequests,
+		drainTimeout:     drainTimeout,
 		srv: &http.Server{
 			Addr:    fmt.Sprintf(":%d", proxyPort),
 			Handler: mux,
 		},
 		proxyRequestHandler: httputil.NewSingleHostReverseProxy(targetURL),
 		ignoredPaths:        ignoredPaths,
+		probeEndpoints:      probeEndpoints,
+		ignoredUserAgentSubstrings: append(
+			append([]string{}, defaultIgnoredUserAgentSubstrings...),
+			ignoredUserAgentSubstrings...,
+		),
 	}
 	s.proxyRequestHandler.Transport = otelhttp.NewTransport(http.DefaultTransport)
+	// /metrics and /drain are served on their own port/mux, not the
+	// app-facing one: an app that serves its own GET /metrics or /drain
+	// (unremarkable for an instrumented service) would otherwise have that
+	// route silently swallowed by the sidecar, with no opt-out, since
+	// http.ServeMux matches an exact path ahead of the catch-all "/"
+	// handler.
+	managementMux := http.NewServeMux()
+	managementMux.HandleFunc("/metrics", s.handleMetricsRequest)
+	managementMux.HandleFunc("/drain", s.handleDrainRequest)
+	s.managementSrv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", managementPort),
+		Handler: managementMux,
+	}
 	mux.Handle("/", otelhttp.NewHandler(
 		http.HandlerFunc(s.handleRequest),
 		"http.request",
@@ -64,21 +113,45 @@ func (s *singlePortProxy) run(ctx context.Context) {
 		select {
 		case <-ctx.Done(): // Context was canceled or expired
 			glog.Infof(
-				"Proxy listening on %s proxying application port %d is shutting down",
+				"Proxy listening on %s proxying application port %d is shutting down; "+
+					"draining in-flight requests (up to %s)",
 				s.srv.Addr,
 				s.appPort,
+				s.drainTimeout,
 			)
-			// Allow up to five seconds for requests in progress to be completed
+			drainStart := time.Now()
+			s.waitForDrain(s.drainTimeout)
+			// Shutdown gets whatever's left of the drain budget, not a
+			// separate timeout of its own -- otherwise worst-case shutdown
+			// would be drainTimeout+5s, defeating an operator's attempt to
+			// align terminationGracePeriodSeconds with --drain-timeout.
+			shutdownTimeout := s.drainTimeout - time.Since(drainStart)
+			if shutdownTimeout < 0 {
+				shutdownTimeout = 0
+			}
 			shutdownCtx, cancel := context.WithTimeout(
 				context.Background(),
-				time.Second*5,
+				shutdownTimeout,
 			)
 			defer cancel()
-			s.srv.Shutdown(shutdownCtx) // nolint: errcheck
+			s.srv.Shutdown(shutdownCtx)           // nolint: errcheck
+			s.managementSrv.Shutdown(shutdownCtx) // nolint: errcheck
 		case <-doneCh: // The server shut down on its own, perhaps due to an error
 		}
 	}()
 
+	go func() {
+		glog.Infof(
+			"Management endpoint for proxy %s is listening on %s",
+			s.proxyID,
+			s.managementSrv.Addr,
+		)
+		err := s.managementSrv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Error from management endpoint for proxy %s: %s", s.proxyID, err)
+		}
+	}()
+
 	glog.Infof(
 		"Proxy listening on %s is proxying application port %d",
 		s.srv.Addr,
@@ -96,12 +169,37 @@ func (s *singlePortProxy) run(ctx context.Context) {
 	close(doneCh)
 }
 
+// waitForDrain polls the in-flight request gauge until it reaches zero or
+// timeout elapses, whichever happens first, so a scale-to-zero decided
+// mid-request doesn't strand the client with a connection reset.
+func (s *singlePortProxy) waitForDrain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(s.inFlightRequests) > 0 {
+		if time.Now().After(deadline) {
+			glog.Warningf(
+				"Proxy listening on %s proxying application port %d timed out waiting to "+
+					"drain %d in-flight request(s)",
+				s.srv.Addr,
+				s.appPort,
+				atomic.LoadInt64(s.inFlightRequests),
+			)
+			return
+		}
+		<-ticker.C
+	}
+}
+
 func (s *singlePortProxy) handleRequest(
 	w http.ResponseWriter,
 	r *http.Request,
 ) {
 	defer r.Body.Close()
 
+	atomic.AddInt64(s.inFlightRequests, 1)
+	defer atomic.AddInt64(s.inFlightRequests, -1)
+
 	span := trace.SpanFromContext(r.Context())
 
 	if glog.V(1) {
@@ -123,8 +221,40 @@ func (s *singlePortProxy) handleRequest(
 	s.proxyRequestHandler.ServeHTTP(w, r)
 }
 
+// handleMetricsRequest exposes the proxy's request count in the standard
+// Prometheus exposition format, alongside the existing bespoke
+// {ProxyID, RequestCount} payload the zeroscaler's default scraper pulls,
+// so the same sidecar can be scraped by both Osiris and a cluster-wide
+// Prometheus.
+func (s *singlePortProxy) handleMetricsRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE osiris_proxy_requests_total counter\n")
+	fmt.Fprintf(
+		w,
+		"osiris_proxy_requests_total{proxy_id=%q} %d\n",
+		s.proxyID,
+		atomic.LoadUint64(s.requestCount),
+	)
+	fmt.Fprintf(w, "# TYPE osiris_proxy_in_flight_requests gauge\n")
+	fmt.Fprintf(
+		w,
+		"osiris_proxy_in_flight_requests{proxy_id=%q} %d\n",
+		s.proxyID,
+		atomic.LoadInt64(s.inFlightRequests),
+	)
+}
+
+// handleDrainRequest is the container's preStop hook target: it blocks
+// until in-flight requests have drained (or the drain timeout elapses),
+// letting Kubernetes' termination grace period line up with the proxy's
+// own drain instead of just racing SIGTERM against it.
+func (s *singlePortProxy) handleDrainRequest(w http.ResponseWriter, r *http.Request) {
+	s.waitForDrain(s.drainTimeout)
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *singlePortProxy) isIgnoredRequest(r *http.Request) bool {
-	return s.isIgnoredPath(r) || isKubeProbe(r)
+	return s.isIgnoredPath(r) || s.isIgnoredProbe(r) || s.isIgnoredUserAgent(r)
 }
 
 func (s *singlePortProxy) isIgnoredPath(r *http.Request) bool {
@@ -135,6 +265,72 @@ func (s *singlePortProxy) isIgnoredPath(r *http.Request) bool {
 	return found
 }
 
-func isKubeProbe(r *http.Request) bool {
-	return strings.Contains(r.Header.Get("User-Agent"), "kube-probe")
+// isIgnoredProbe matches a request against the kubelet-configured
+// liveness/readiness/startup probe endpoints resolved by the injector, so
+// probes are recognized by where they hit rather than by sniffing their
+// User-Agent, which custom probes and sidecars (Envoy health checks, for
+// instance) don't reliably set.
+func (s *singlePortProxy) isIgnoredProbe(r *http.Request) bool {
+	if len(s.probeEndpoints) == 0 {
+		return false
+	}
+	host := normalizeProbeHost(r.Host)
+	port := portOf(r.Host)
+	path := r.URL.Path
+	for _, pe := range s.probeEndpoints {
+		if pe.Path != path {
+			continue
+		}
+		if pe.Host != "" && !strings.EqualFold(normalizeProbeHost(pe.Host), host) {
+			continue
+		}
+		if pe.Port != "" && pe.Port != port {
+			continue
+		}
+		if !headersMatch(r.Header, pe.Headers) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// isIgnoredUserAgent matches substrings configured via the
+// `osiris.dm.gg/ignoredUserAgents` annotation (plus the built-in
+// "kube-probe" substring, kept for backward compatibility), letting
+// operators ignore Envoy, Consul, or other custom health-check clients
+// without a code change.
+func (s *singlePortProxy) isIgnoredUserAgent(r *http.Request) bool {
+	ua := r.Header.Get("User-Agent")
+	for _, substr := range s.ignoredUserAgentSubstrings {
+		if strings.Contains(ua, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeProbeHost strips an optional port and IPv6 brackets so hosts can
+// be compared on the bare hostname/IP alone.
+func normalizeProbeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.Trim(host, "[]")
+}
+
+func portOf(host string) string {
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		return port
+	}
+	return ""
+}
+
+func headersMatch(got http.Header, want map[string]string) bool {
+	for name, value := range want {
+		if got.Get(name) != value {
+			return false
+		}
+	}
+	return true
 }
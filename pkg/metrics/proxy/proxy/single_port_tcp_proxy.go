@@ -0,0 +1,288 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// proxyProtocol identifies the wire protocol a singlePortTCPProxy relays, as
+// selected by the `osiris.dm.gg/proxy.protocol` annotation on the injected
+// sidecar.
+type proxyProtocol string
+
+const (
+	proxyProtocolHTTP proxyProtocol = "http"
+	proxyProtocolTCP  proxyProtocol = "tcp"
+	proxyProtocolGRPC proxyProtocol = "grpc"
+
+	// copyBufferSize is used for the raw TCP io.Copy relay.
+	copyBufferSize = 32 * 1024
+)
+
+// singlePortTCPProxy is the non-HTTP-aware sibling of singlePortProxy. It
+// proxies raw TCP connections (or, in grpc mode, HTTP/2 streams spoken with
+// prior knowledge) instead of wrapping httputil.ReverseProxy, so that
+// workloads like databases or long-lived gRPC streams can be traffic-counted
+// and scaled to zero the same way HTTP workloads are.
+type singlePortTCPProxy struct {
+	appPort          int
+	proxyID          string
+	protocol         proxyProtocol
+	openConnections  *int64
+	totalConnections *uint64
+	requestCount     *uint64
+	appAddr          string
+	listener         net.Listener
+	srv              *http.Server // only used in grpc mode
+	metricsSrv       *http.Server
+	transport        *http2.Transport // only used in grpc mode
+}
+
+func newSinglePortTCPProxy(
+	proxyPort int,
+	metricsPort int,
+	appPort int,
+	proxyID string,
+	protocol proxyProtocol,
+	openConnections *int64,
+	totalConnections *uint64,
+	requestCount *uint64,
+) (*singlePortTCPProxy, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", proxyPort))
+	if err != nil {
+		return nil, err
+	}
+	s := &singlePortTCPProxy{
+		appPort:          appPort,
+		proxyID:          proxyID,
+		protocol:         protocol,
+		openConnections:  openConnections,
+		totalConnections: totalConnections,
+		requestCount:     requestCount,
+		appAddr:          fmt.Sprintf("localhost:%d", appPort),
+		listener:         listener,
+	}
+	if protocol == proxyProtocolGRPC {
+		h2s := &http2.Server{}
+		s.srv = &http.Server{
+			Handler: h2c.NewHandler(http.HandlerFunc(s.handleGRPCRequest), h2s),
+		}
+		// Built once and reused across every proxied stream: constructing a
+		// *http2.Transport per request dials a brand-new connection to the
+		// application and never tears it down, leaking a goroutine and a
+		// file descriptor per request.
+		s.transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}
+	}
+	metricsMux := http.NewServeMux()
+	metricsMux.HandleFunc("/metrics", s.handleMetricsRequest)
+	s.metricsSrv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", metricsPort),
+		Handler: metricsMux,
+	}
+	return s, nil
+}
+
+func (s *singlePortTCPProxy) run(ctx context.Context) {
+	doneCh := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			glog.Infof(
+				"Proxy listening on %s proxying application port %d is shutting down",
+				s.listener.Addr(),
+				s.appPort,
+			)
+			s.listener.Close()   // nolint: errcheck
+			s.metricsSrv.Close() // nolint: errcheck
+		case <-doneCh:
+		}
+	}()
+
+	go func() {
+		glog.Infof("Metrics endpoint for proxy %s is listening on %s", s.proxyID, s.metricsSrv.Addr)
+		err := s.metricsSrv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Error from metrics endpoint for proxy %s: %s", s.proxyID, err)
+		}
+	}()
+
+	glog.Infof(
+		"Proxy listening on %s is proxying application port %d over %s",
+		s.listener.Addr(),
+		s.appPort,
+		s.protocol,
+	)
+
+	var err error
+	if s.protocol == proxyProtocolGRPC {
+		err = s.srv.Serve(s.countingListener())
+	} else {
+		err = s.serveTCP(s.countingListener())
+	}
+	if err != nil && ctx.Err() == nil {
+		glog.Errorf(
+			"Error from proxy listening on %s proxying application port %d: %s",
+			s.listener.Addr(),
+			s.appPort,
+			err,
+		)
+	}
+	close(doneCh)
+}
+
+// handleMetricsRequest exposes the proxy's connection and request counters
+// in the standard Prometheus exposition format, so the zeroscaler's
+// scraper can read them for workloads running in tcp/grpc mode the same
+// way it does for the HTTP proxy.
+func (s *singlePortTCPProxy) handleMetricsRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE osiris_proxy_requests_total counter\n")
+	fmt.Fprintf(
+		w,
+		"osiris_proxy_requests_total{proxy_id=%q} %d\n",
+		s.proxyID,
+		atomic.LoadUint64(s.requestCount),
+	)
+	fmt.Fprintf(w, "# TYPE osiris_proxy_open_connections gauge\n")
+	fmt.Fprintf(
+		w,
+		"osiris_proxy_open_connections{proxy_id=%q} %d\n",
+		s.proxyID,
+		atomic.LoadInt64(s.openConnections),
+	)
+	fmt.Fprintf(w, "# TYPE osiris_proxy_connections_total counter\n")
+	fmt.Fprintf(
+		w,
+		"osiris_proxy_connections_total{proxy_id=%q} %d\n",
+		s.proxyID,
+		atomic.LoadUint64(s.totalConnections),
+	)
+}
+
+// countingListener wraps the proxy's listener so every accepted connection
+// increments totalConnections (monotonic) and openConnections (gauge), and
+// every closed connection decrements openConnections.
+func (s *singlePortTCPProxy) countingListener() net.Listener {
+	return &connCountingListener{
+		Listener:         s.listener,
+		openConnections:  s.openConnections,
+		totalConnections: s.totalConnections,
+	}
+}
+
+// serveTCP accepts connections and relays bytes in both directions until
+// the listener is closed.
+func (s *singlePortTCPProxy) serveTCP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.relayTCPConn(conn)
+	}
+}
+
+func (s *singlePortTCPProxy) relayTCPConn(clientConn net.Conn) {
+	defer clientConn.Close() // nolint: errcheck
+
+	appConn, err := net.Dial("tcp", s.appAddr)
+	if err != nil {
+		glog.Errorf("Error dialing application port %d: %s", s.appPort, err)
+		return
+	}
+	defer appConn.Close() // nolint: errcheck
+
+	doneCh := make(chan struct{}, 2)
+	relay := func(dst, src net.Conn) {
+		buf := make([]byte, copyBufferSize)
+		io.CopyBuffer(dst, src, buf) // nolint: errcheck
+		doneCh <- struct{}{}
+	}
+	go relay(appConn, clientConn)
+	go relay(clientConn, appConn)
+	<-doneCh
+}
+
+// handleGRPCRequest proxies a single HTTP/2 stream to the application and
+// counts it against the same requestCount the HTTP proxy uses, so that a
+// gRPC-bidi stream's many messages over one long-lived connection are
+// counted per-stream rather than per-connection.
+func (s *singlePortTCPProxy) handleGRPCRequest(w http.ResponseWriter, r *http.Request) {
+	requestCount := atomic.AddUint64(s.requestCount, 1)
+	if glog.V(2) {
+		glog.Infof(
+			"Counting gRPC stream on app port %d: %s. Current request count is: %v",
+			s.appPort,
+			r.RequestURI,
+			requestCount,
+		)
+	}
+
+	targetURL := r.URL
+	targetURL.Scheme = "http"
+	targetURL.Host = s.appAddr
+
+	resp, err := s.transport.RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body) // nolint: errcheck
+}
+
+// connCountingListener wraps a net.Listener, tracking open and total
+// connection counts for the zeroscaler's idleness decision.
+type connCountingListener struct {
+	net.Listener
+	openConnections  *int64
+	totalConnections *uint64
+}
+
+func (l *connCountingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(l.openConnections, 1)
+	atomic.AddUint64(l.totalConnections, 1)
+	return &countingConn{Conn: conn, openConnections: l.openConnections}, nil
+}
+
+// countingConn decrements openConnections exactly once, whenever the
+// connection is closed, however that happens (client hangup, idle timeout,
+// or server shutdown).
+type countingConn struct {
+	net.Conn
+	openConnections *int64
+	closeOnce       int32
+}
+
+func (c *countingConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closeOnce, 0, 1) {
+		atomic.AddInt64(c.openConnections, -1)
+	}
+	return c.Conn.Close()
+}